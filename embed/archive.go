@@ -0,0 +1,248 @@
+package embed
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+)
+
+// isArchivePath reports whether name's extension marks it as a container to
+// be walked (via openArchive) rather than embedded as a single file.
+func isArchivePath(name string) bool {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".zip"),
+		strings.HasSuffix(lower, ".tar"),
+		strings.HasSuffix(lower, ".tar.gz"),
+		strings.HasSuffix(lower, ".tgz"):
+		return true
+	default:
+		return false
+	}
+}
+
+// openArchive reads data (the raw bytes of a .zip, .tar, .tar.gz, or .tgz
+// file, keyed off name's extension) and returns an fs.FS over its contents,
+// rooted at the archive's own root.
+func openArchive(name string, data []byte) (fs.FS, error) {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		return zr, nil
+	case strings.HasSuffix(lower, ".tar"):
+		return newTarFS(name, bytes.NewReader(data))
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		gr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		defer gr.Close()
+		return newTarFS(name, gr)
+	default:
+		return nil, fmt.Errorf("%s: not an archive esc knows how to read", name)
+	}
+}
+
+// archiveFS is a read-only, in-memory fs.FS. Unlike archive/zip, archive/tar
+// has no built-in fs.FS view, so newTarFS fully unpacks a tar stream into
+// one of these; it also backs the expansion of any directories the stream
+// didn't record headers for.
+type archiveFS struct {
+	files map[string]*archiveFileData
+}
+
+type archiveFileData struct {
+	data     []byte
+	modTime  time.Time
+	mode     fs.FileMode
+	linkname string
+	uid, gid int
+}
+
+func newTarFS(archiveName string, r io.Reader) (fs.FS, error) {
+	a := &archiveFS{files: make(map[string]*archiveFileData)}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", archiveName, err)
+		}
+		name := path.Clean(hdr.Name)
+		if name == "." || hdr.Typeflag == tar.TypeDir {
+			continue
+		}
+		b, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %v", archiveName, hdr.Name, err)
+		}
+		a.files[name] = &archiveFileData{
+			data:     b,
+			modTime:  hdr.ModTime,
+			mode:     hdr.FileInfo().Mode(),
+			linkname: hdr.Linkname,
+			uid:      hdr.Uid,
+			gid:      hdr.Gid,
+		}
+	}
+	return a, nil
+}
+
+func (a *archiveFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if f, ok := a.files[name]; ok {
+		return &archiveFileHandle{archiveFileData: f, name: name, Reader: bytes.NewReader(f.data)}, nil
+	}
+	if name == "." || a.hasChild(name) {
+		return &archiveDirHandle{fsys: a, name: name}, nil
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+func (a *archiveFS) hasChild(dir string) bool {
+	prefix := dir + "/"
+	for name := range a.files {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// readDir lists the direct children of dir (use "." for the root).
+func (a *archiveFS) readDir(dir string) []fs.DirEntry {
+	prefix := ""
+	if dir != "." {
+		prefix = dir + "/"
+	}
+	seen := make(map[string]bool)
+	var entries []fs.DirEntry
+	for name, f := range a.files {
+		rest := strings.TrimPrefix(name, prefix)
+		if rest == name && prefix != "" {
+			continue // not under dir
+		}
+		if i := strings.Index(rest, "/"); i >= 0 {
+			child := rest[:i]
+			if !seen[child] {
+				seen[child] = true
+				entries = append(entries, &archiveDirEntry{name: child, dir: true})
+			}
+			continue
+		}
+		if !seen[rest] {
+			seen[rest] = true
+			entries = append(entries, &archiveDirEntry{name: rest, dir: false, data: f})
+		}
+	}
+	return entries
+}
+
+// archiveFileHandle adapts an archiveFileData into an fs.File.
+type archiveFileHandle struct {
+	*archiveFileData
+	*bytes.Reader
+	name string
+}
+
+func (h *archiveFileHandle) Stat() (fs.FileInfo, error) {
+	return &archiveFileInfo{h.archiveFileData, path.Base(h.name)}, nil
+}
+func (h *archiveFileHandle) Close() error { return nil }
+
+type archiveFileInfo struct {
+	*archiveFileData
+	name string
+}
+
+func (i *archiveFileInfo) Name() string       { return i.name }
+func (i *archiveFileInfo) Size() int64        { return int64(len(i.data)) }
+func (i *archiveFileInfo) Mode() fs.FileMode  { return i.mode }
+func (i *archiveFileInfo) ModTime() time.Time { return i.modTime }
+func (i *archiveFileInfo) IsDir() bool        { return false }
+func (i *archiveFileInfo) Sys() interface{}   { return nil }
+
+// LinkName and Owner let embed.go's walkInto recover symlink and ownership
+// metadata from a tar entry without needing archiveFileInfo's concrete type.
+func (i *archiveFileInfo) LinkName() string { return i.linkname }
+func (i *archiveFileInfo) Owner() (uid, gid int, ok bool) {
+	return i.uid, i.gid, true
+}
+
+// archiveDirHandle adapts a synthesized directory into an fs.ReadDirFile.
+type archiveDirHandle struct {
+	fsys    *archiveFS
+	name    string
+	entries []fs.DirEntry
+	pos     int
+}
+
+func (h *archiveDirHandle) Stat() (fs.FileInfo, error) { return archiveDirInfo(path.Base(h.name)), nil }
+func (h *archiveDirHandle) Read([]byte) (int, error) {
+	return 0, fmt.Errorf("%s: is a directory", h.name)
+}
+func (h *archiveDirHandle) Close() error { return nil }
+
+func (h *archiveDirHandle) ReadDir(n int) ([]fs.DirEntry, error) {
+	if h.entries == nil {
+		h.entries = h.fsys.readDir(h.name)
+	}
+	if h.pos >= len(h.entries) {
+		if n <= 0 {
+			return nil, nil
+		}
+		return nil, io.EOF
+	}
+	end := len(h.entries)
+	if n > 0 && h.pos+n < end {
+		end = h.pos + n
+	}
+	res := h.entries[h.pos:end]
+	h.pos = end
+	return res, nil
+}
+
+type archiveDirEntry struct {
+	name string
+	dir  bool
+	data *archiveFileData
+}
+
+func (e *archiveDirEntry) Name() string { return e.name }
+func (e *archiveDirEntry) IsDir() bool  { return e.dir }
+func (e *archiveDirEntry) Type() fs.FileMode {
+	if e.dir {
+		return fs.ModeDir
+	}
+	return e.data.mode.Type()
+}
+func (e *archiveDirEntry) Info() (fs.FileInfo, error) {
+	if e.dir {
+		return archiveDirInfo(e.name), nil
+	}
+	return &archiveFileInfo{e.data, e.name}, nil
+}
+
+type archiveDirInfo string
+
+func (i archiveDirInfo) Name() string       { return string(i) }
+func (i archiveDirInfo) Size() int64        { return 0 }
+func (i archiveDirInfo) Mode() fs.FileMode  { return fs.ModeDir }
+func (i archiveDirInfo) ModTime() time.Time { return time.Time{} }
+func (i archiveDirInfo) IsDir() bool        { return true }
+func (i archiveDirInfo) Sys() interface{}   { return nil }
@@ -0,0 +1,156 @@
+package embed
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"io/fs"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestOpenArchive_Zip(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range map[string]string{
+		"a.txt":   "aaa",
+		"b/c.txt": "ccc",
+	} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	fsys, err := openArchive("archive.zip", buf.Bytes())
+	if err != nil {
+		t.Fatalf("openArchive: %v", err)
+	}
+	assertArchiveContents(t, fsys, map[string]string{
+		"a.txt":   "aaa",
+		"b/c.txt": "ccc",
+	})
+}
+
+func TestOpenArchive_Tar(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	files := []struct {
+		name, content string
+	}{
+		{"a.txt", "aaa"},
+		{"b/c.txt", "ccc"},
+	}
+	for _, f := range files {
+		hdr := &tar.Header{
+			Name:    f.name,
+			Size:    int64(len(f.content)),
+			Mode:    0644,
+			ModTime: time.Unix(1700000000, 0),
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(f.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A symlink entry, to exercise the same linkname/uid/gid plumbing Run
+	// relies on via archiveFileInfo's duck-typed LinkName/Owner methods.
+	if err := tw.WriteHeader(&tar.Header{
+		Name:     "link.txt",
+		Typeflag: tar.TypeSymlink,
+		Linkname: "a.txt",
+		Uid:      42,
+		Gid:      7,
+		ModTime:  time.Unix(1700000000, 0),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	fsys, err := openArchive("archive.tar", buf.Bytes())
+	if err != nil {
+		t.Fatalf("openArchive: %v", err)
+	}
+	assertArchiveContents(t, fsys, map[string]string{
+		"a.txt":    "aaa",
+		"b/c.txt":  "ccc",
+		"link.txt": "", // a symlink header carries no data of its own
+	})
+
+	f, err := fsys.Open("link.txt")
+	if err != nil {
+		t.Fatalf("Open(link.txt): %v", err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		t.Fatalf("Stat(link.txt): %v", err)
+	}
+	if fi.Mode()&fs.ModeSymlink == 0 {
+		t.Errorf("link.txt mode %v missing ModeSymlink", fi.Mode())
+	}
+	lk, ok := fi.(interface{ LinkName() string })
+	if !ok || lk.LinkName() != "a.txt" {
+		t.Errorf("link.txt LinkName() = %+v, want \"a.txt\"", lk)
+	}
+	ow, ok := fi.(interface{ Owner() (int, int, bool) })
+	if !ok {
+		t.Fatal("archiveFileInfo does not implement Owner()")
+	}
+	if uid, gid, captured := ow.Owner(); !captured || uid != 42 || gid != 7 {
+		t.Errorf("Owner() = (%d, %d, %v), want (42, 7, true)", uid, gid, captured)
+	}
+}
+
+// assertArchiveContents walks fsys with fs.WalkDir and checks that exactly
+// the given files are present with the expected content, exercising the
+// same traversal Run uses (archiveFS has no native fs.FS support to fall
+// back on for .tar, unlike zip.Reader).
+func assertArchiveContents(t *testing.T, fsys fs.FS, want map[string]string) {
+	t.Helper()
+	got := map[string]string{}
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		b, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return err
+		}
+		got[p] = string(b)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("fs.WalkDir: %v", err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d files, want %d (got=%v)", len(got), len(want), keys(got))
+	}
+	for name, content := range want {
+		if got[name] != content {
+			t.Errorf("%s = %q, want %q", name, got[name], content)
+		}
+	}
+}
+
+func keys(m map[string]string) []string {
+	ks := make([]string, 0, len(m))
+	for k := range m {
+		ks = append(ks, k)
+	}
+	sort.Strings(ks)
+	return ks
+}
@@ -6,7 +6,8 @@ import (
 	"compress/gzip"
 	"encoding/base64"
 	"fmt"
-	"io/ioutil"
+	"io"
+	"io/fs"
 	"os"
 	"path"
 	"path/filepath"
@@ -19,8 +20,6 @@ import (
 
 // Config contains all information needed to run esc.
 type Config struct {
-	// OutputFile is the file name to write output, else stdout.
-	OutputFile string
 	// Package name for the generated file.
 	Package string
 	// Prefix is stripped from filenames.
@@ -36,6 +35,29 @@ type Config struct {
 	Private bool
 	// NoCompression, if true, stores the files without compression.
 	NoCompression bool
+	// Watch, if true, tells the caller to keep re-running Run: WaitForChange
+	// watches every directory reached by Files (and any subdirectories
+	// created afterward) and returns whenever a file in one of them changes,
+	// debounced. Include and Ignore are not applied to these changes. It
+	// requires Files to name real paths on disk.
+	Watch bool
+	// ShardBytes, if greater than zero, tells RunSharded to split its output
+	// across multiple files once the aggregate compressed size of the
+	// embedded data exceeds it, instead of producing one large file. It has
+	// no effect on Run.
+	ShardBytes int64
+	// PreserveOwnership, if true, additionally captures each file's uid and
+	// gid (via its platform Stat_t, where available) alongside the mode and
+	// symlink target that are always captured.
+	PreserveOwnership bool
+
+	// Source is the filesystem that Files are resolved against, which lets
+	// callers embed from anything that satisfies fs.FS (an in-memory tree, an
+	// afero backend, a zip.Reader, ...) instead of only the local disk. If
+	// nil, Run defaults it to an os.DirFS of the current directory, and
+	// entries of Files may additionally be absolute paths, matching esc's
+	// historical, disk-only behavior.
+	Source fs.FS
 
 	// Files is the list of files or directories to embed.
 	Files []string
@@ -53,152 +75,371 @@ type _escFile struct {
 	data     []byte
 	local    string
 	fileinfo os.FileInfo
+	mode     os.FileMode
+	linkname string
+	// uid and gid are -1 unless Config.PreserveOwnership captured them.
+	uid, gid int
 }
 
-// Run executes a Config.
-func Run(conf *Config) error {
-	var err error
+// embedContent walks conf.Files (and any archives or custom Source among
+// them) and returns every embedded file, keyed by its post-prefix virtual
+// name (fnames, sorted), plus every directory reached (dirnames, sorted).
+// It is the walk phase shared by Run and RunSharded.
+func embedContent(conf *Config) (fnames, dirnames []string, content map[string]_escFile, prefix string, usingDefaultSource bool, err error) {
 	if conf.ModTime != "" {
-		i, err := strconv.ParseInt(conf.ModTime, 10, 64)
-		if err != nil {
-			return fmt.Errorf("modtime must be an integer: %v", err)
+		i, perr := strconv.ParseInt(conf.ModTime, 10, 64)
+		if perr != nil {
+			return nil, nil, nil, "", false, fmt.Errorf("modtime must be an integer: %v", perr)
 		}
 		modTime = &i
 	}
-	var fnames, dirnames []string
-	content := make(map[string]_escFile)
-	prefix := filepath.ToSlash(conf.Prefix)
+	content = make(map[string]_escFile)
+	prefix = filepath.ToSlash(conf.Prefix)
 	var ignoreRegexp *regexp.Regexp
 	if conf.Ignore != "" {
-		ignoreRegexp, err = regexp.Compile(conf.Ignore)
-		if err != nil {
-			return err
+		if ignoreRegexp, err = regexp.Compile(conf.Ignore); err != nil {
+			return nil, nil, nil, "", false, err
 		}
 	}
 	var includeRegexp *regexp.Regexp
 	if conf.Include != "" {
-		includeRegexp, err = regexp.Compile(conf.Include)
-		if err != nil {
-			return err
+		if includeRegexp, err = regexp.Compile(conf.Include); err != nil {
+			return nil, nil, nil, "", false, err
 		}
 	}
-	for _, base := range conf.Files {
-		files := []string{base}
-		for len(files) > 0 {
-			fname := files[0]
-			files = files[1:]
-			if ignoreRegexp != nil && ignoreRegexp.MatchString(fname) {
-				continue
-			}
-			f, err := os.Open(fname)
+	source := conf.Source
+	usingDefaultSource = source == nil
+	if usingDefaultSource {
+		source = os.DirFS(".")
+	}
+	// walkInto walks fsys starting at walkBase, adding every matching file to
+	// content/fnames. fpathOf reconstructs, for a given walked name, the path
+	// used both for -prefix stripping and (when non-blank) as the file's
+	// local disk path.
+	walkInto := func(fsys fs.FS, walkBase string, blankLocal bool, fpathOf func(string) string) error {
+		return fs.WalkDir(fsys, walkBase, func(fname string, d fs.DirEntry, err error) error {
 			if err != nil {
 				return err
 			}
-			fi, err := f.Stat()
+			if ignoreRegexp != nil && ignoreRegexp.MatchString(fname) {
+				if d.IsDir() {
+					return fs.SkipDir
+				}
+				return nil
+			}
+			if d.IsDir() {
+				return nil
+			}
+			if includeRegexp != nil && !includeRegexp.MatchString(fname) {
+				return nil
+			}
+			fi, err := d.Info()
 			if err != nil {
 				return err
 			}
-			if fi.IsDir() {
-				fis, err := f.Readdir(0)
-				if err != nil {
-					return err
-				}
-				for _, fi := range fis {
-					files = append(files, filepath.Join(fname, fi.Name()))
+			fpath := fpathOf(fname)
+			local := ""
+			if !blankLocal {
+				local = fpath
+			}
+			mode := fi.Mode()
+			linkname := ""
+			var b []byte
+			if mode&fs.ModeSymlink != 0 {
+				// A symlink's target may not exist, or may be a directory;
+				// either way fs.ReadFile would follow it, so never read
+				// through a symlink. Record only where it points.
+				if local != "" {
+					if target, lerr := os.Readlink(local); lerr == nil {
+						linkname = target
+					}
+				} else if lk, ok := fi.(interface{ LinkName() string }); ok {
+					linkname = lk.LinkName()
 				}
-			} else if includeRegexp == nil || includeRegexp.MatchString(fname) {
-				b, err := ioutil.ReadAll(f)
+			} else {
+				b, err = fs.ReadFile(fsys, fname)
 				if err != nil {
 					return err
 				}
-				fpath := filepath.ToSlash(fname)
-				n := strings.TrimPrefix(fpath, prefix)
-				n = path.Join("/", n)
-				if _, ok := content[n]; ok {
-					return fmt.Errorf("%s, %s: duplicate name after prefix removal", n, fpath)
+			}
+			n := strings.TrimPrefix(fpath, prefix)
+			n = path.Join("/", n)
+			if _, ok := content[n]; ok {
+				return fmt.Errorf("%s, %s: duplicate name after prefix removal", n, fpath)
+			}
+			uid, gid := -1, -1
+			if conf.PreserveOwnership {
+				if local != "" {
+					uid, gid = statOwnership(fi)
+				} else if ow, ok := fi.(interface{ Owner() (int, int, bool) }); ok {
+					if u, g, captured := ow.Owner(); captured {
+						uid, gid = u, g
+					}
 				}
-				content[n] = _escFile{data: b, local: fpath, fileinfo: fi}
-				fnames = append(fnames, n)
 			}
-			f.Close()
+			content[n] = _escFile{data: b, local: local, fileinfo: fi, mode: mode, linkname: linkname, uid: uid, gid: gid}
+			fnames = append(fnames, n)
+			return nil
+		})
+	}
+	identity := func(fname string) string { return fname }
+	for _, base := range conf.Files {
+		if isArchivePath(base) {
+			// os.DirFS(".") can't walk absolute paths either, so resolve the
+			// archive's own bytes the same way a plain file base would be.
+			fsys := source
+			readBase := base
+			if usingDefaultSource && path.IsAbs(filepath.ToSlash(base)) {
+				fsys = os.DirFS("/")
+				readBase = strings.TrimPrefix(filepath.ToSlash(base), "/")
+			}
+			data, rerr := fs.ReadFile(fsys, readBase)
+			if rerr != nil {
+				return nil, nil, nil, "", false, rerr
+			}
+			archFS, rerr := openArchive(base, data)
+			if rerr != nil {
+				return nil, nil, nil, "", false, rerr
+			}
+			// Archive contents have no meaningful on-disk local path, so
+			// -local mode is unavailable for them regardless of Source.
+			if rerr := walkInto(archFS, ".", true, identity); rerr != nil {
+				return nil, nil, nil, "", false, rerr
+			}
+			continue
+		}
+		// os.DirFS(".") can't walk absolute paths, but esc has always
+		// accepted them when reading straight from disk: root the walk at
+		// the filesystem root instead, and restore the leading "/" below so
+		// -prefix stripping behaves exactly as it did pre-fs.FS.
+		fsys := source
+		walkBase := base
+		absBase := false
+		if usingDefaultSource && path.IsAbs(filepath.ToSlash(base)) {
+			fsys = os.DirFS("/")
+			walkBase = strings.TrimPrefix(filepath.ToSlash(base), "/")
+			absBase = true
+		}
+		fpathOf := identity
+		if absBase {
+			fpathOf = func(fname string) string { return "/" + fname }
+		}
+		if rerr := walkInto(fsys, walkBase, !usingDefaultSource, fpathOf); rerr != nil {
+			return nil, nil, nil, "", false, rerr
 		}
 	}
 	sort.Strings(fnames)
-	w := new(bytes.Buffer)
-	headerText, err := header(conf.Package, !(conf.Private))
-	if nil != err {
-		return fmt.Errorf("failed to expand autogenerated code: %s", err)
+	dirs := map[string]bool{"/": true}
+	for _, fname := range fnames {
+		for b := path.Dir(fname); b != "/"; b = path.Dir(b) {
+			dirs[b] = true
+		}
 	}
-	if _, err := w.Write(headerText); err != nil {
-		return fmt.Errorf("failed to write output: %s", err)
+	for d := range dirs {
+		dirnames = append(dirnames, d)
 	}
-	dirs := map[string]bool{"/": true}
+	sort.Strings(dirnames)
+	return fnames, dirnames, content, prefix, usingDefaultSource, nil
+}
+
+// renderedFile is one embedded file's gzip-compressed, base64-segmented
+// _escFile block (everything between its braces in the generated map
+// literal or init() assignment), along with the compressed byte count
+// RunSharded packs shards by.
+type renderedFile struct {
+	name          string
+	block         string
+	compressedLen int
+}
+
+// renderFiles gzip-compresses (or, if noCompression, just copies) every file
+// in fnames and renders its _escFile block.
+func renderFiles(fnames []string, content map[string]_escFile, noCompression bool) ([]renderedFile, error) {
 	gzipLevel := gzip.BestCompression
-	if conf.NoCompression {
+	if noCompression {
 		gzipLevel = gzip.NoCompression
 	}
+	rendered := make([]renderedFile, 0, len(fnames))
 	for _, fname := range fnames {
 		f := content[fname]
-		for b := path.Dir(fname); b != "/"; b = path.Dir(b) {
-			dirs[b] = true
-		}
 		var buf bytes.Buffer
 		gw, err := gzip.NewWriterLevel(&buf, gzipLevel)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		if _, err := gw.Write(f.data); err != nil {
-			return err
+			return nil, err
 		}
 		if err := gw.Close(); err != nil {
-			return err
+			return nil, err
 		}
 		t := f.fileinfo.ModTime().Unix()
 		if modTime != nil {
 			t = *modTime
 		}
-		fmt.Fprintf(w, `
-	%q: {
-		local:   %q,
-		size:    %v,
-		modtime: %v,
+		rendered = append(rendered, renderedFile{
+			name: fname,
+			block: fmt.Sprintf(`
+		local:    %q,
+		size:     %v,
+		modtime:  %v,
+		mode:     %#o,
+		linkname: %q,
+		uid:      %d,
+		gid:      %d,
 		compressed: %s,
-	},%s`, fname, f.local, len(f.data), t, segment(&buf), "\n")
+`, f.local, len(f.data), t, f.mode, f.linkname, f.uid, f.gid, segment(&buf)),
+			compressedLen: buf.Len(),
+		})
 	}
-	for d := range dirs {
-		dirnames = append(dirnames, d)
+	return rendered, nil
+}
+
+// dirLocal computes the local field for dir the same way Run always has:
+// blank unless conf's source is the real, default filesystem.
+func dirLocal(dir, prefix string, usingDefaultSource bool) string {
+	if !usingDefaultSource {
+		return ""
+	}
+	local := path.Join(prefix, dir)
+	if len(local) == 0 {
+		return "."
+	}
+	if local[0] == '/' {
+		// Read dirs relative to the go proc's cwd vs system's fs root.
+		local = local[1:]
+	}
+	return local
+}
+
+// Run executes a Config once, writing the generated code to out. Callers
+// that want conf.Watch's re-run-on-change behavior drive the loop
+// themselves, using WaitForChange between calls to Run.
+func Run(conf *Config, out io.Writer) error {
+	fnames, dirnames, content, prefix, usingDefaultSource, err := embedContent(conf)
+	if err != nil {
+		return err
+	}
+	w := new(bytes.Buffer)
+	headerText, err := header(conf.Package, !(conf.Private))
+	if nil != err {
+		return fmt.Errorf("failed to expand autogenerated code: %s", err)
+	}
+	if _, err := w.Write(headerText); err != nil {
+		return fmt.Errorf("failed to write output: %s", err)
+	}
+	rendered, err := renderFiles(fnames, content, conf.NoCompression)
+	if err != nil {
+		return err
+	}
+	for _, f := range rendered {
+		fmt.Fprintf(w, "\n\t%q: {%s\t},\n", f.name, f.block)
 	}
-	sort.Strings(dirnames)
 	for _, dir := range dirnames {
-		local := path.Join(prefix, dir)
-		if len(local) == 0 {
-			local = "."
-		}
-		if local[0] == '/' {
-			// Read dirs relative to the go proc's cwd vs system's
-			// fs root.
-			local = local[1:]
-		}
 		fmt.Fprintf(w, `
 	%q: {
 		isDir: true,
 		local: %q,
-	},%s`, dir, local, "\n")
+		uid:   -1,
+		gid:   -1,
+	},%s`, dir, dirLocal(dir, prefix, usingDefaultSource), "\n")
 	}
 	w.WriteString(footer)
-	out := os.Stdout
-	if conf.OutputFile != "" {
-		if out, err = os.Create(conf.OutputFile); err != nil {
-			return err
+	_, err = w.WriteTo(out)
+	return err
+}
+
+// Shard is one generated file produced by RunSharded. Suffix is appended to
+// the caller's base output filename to form the file's actual name, e.g.
+// Suffix "_common" or "_0" turns "assets.go" into "assets_common.go" or
+// "assets_0.go"; the unsharded case returns a single Shard with Suffix "".
+type Shard struct {
+	Suffix string
+	Code   []byte
+}
+
+// RunSharded behaves like Run, but once the aggregate compressed size of the
+// embedded files exceeds conf.ShardBytes, it splits the generated code
+// across multiple sibling files instead of one: a "_common" shard holds the
+// package's shared type declarations, exported functions, and the (initially
+// empty) _escData map, while the map's entries are packed, in deterministic
+// fname order, into sequentially numbered "_0", "_1", ... shards, each
+// contributing its slice of entries via its own init(). This keeps any
+// single generated file - and therefore any single compilation unit - small
+// regardless of how much is embedded.
+//
+// If conf.ShardBytes is 0, or the content fits within it, RunSharded returns
+// a single unsharded Shard whose Code is byte-identical to what Run would
+// have written.
+func RunSharded(conf *Config) ([]Shard, error) {
+	fnames, dirnames, content, prefix, usingDefaultSource, err := embedContent(conf)
+	if err != nil {
+		return nil, err
+	}
+	rendered, err := renderFiles(fnames, content, conf.NoCompression)
+	if err != nil {
+		return nil, err
+	}
+	var total int64
+	for _, f := range rendered {
+		total += int64(f.compressedLen)
+	}
+	if conf.ShardBytes <= 0 || total <= conf.ShardBytes {
+		var buf bytes.Buffer
+		if err := Run(conf, &buf); err != nil {
+			return nil, err
 		}
+		return []Shard{{Code: buf.Bytes()}}, nil
 	}
-	if _, err := w.WriteTo(out); err != nil {
-		return err
+
+	invocation := strings.Join(os.Args[1:], " ")
+	generatedComment := fmt.Sprintf("// Code generated by \"esc %s\"; DO NOT EDIT.\n\n", invocation)
+
+	headerText, err := header(conf.Package, !(conf.Private))
+	if nil != err {
+		return nil, fmt.Errorf("failed to expand autogenerated code: %s", err)
 	}
-	if conf.OutputFile != "" {
-		return out.Close()
+	common := new(bytes.Buffer)
+	common.Write(headerText)
+	common.WriteString(footer)
+	if len(dirnames) > 0 {
+		common.WriteString("\nfunc init() {\n")
+		for _, dir := range dirnames {
+			fmt.Fprintf(common, "\t_escData[%q] = &_escFile{isDir: true, local: %q, uid: -1, gid: -1}\n", dir, dirLocal(dir, prefix, usingDefaultSource))
+		}
+		common.WriteString("}\n")
 	}
-	return nil
+	shards := []Shard{{Suffix: "_common", Code: common.Bytes()}}
+
+	// Greedily pack fnames, already sorted, into shards bounded by
+	// ShardBytes: a run of consecutive files is deterministic regardless of
+	// how many times esc is invoked, which is what makes the split
+	// reproducible across builds.
+	var cur *bytes.Buffer
+	var curSize int64
+	flush := func() {
+		if cur == nil {
+			return
+		}
+		cur.WriteString("}\n")
+		shards = append(shards, Shard{Suffix: fmt.Sprintf("_%d", len(shards)-1), Code: cur.Bytes()})
+		cur = nil
+	}
+	for _, f := range rendered {
+		if cur != nil && curSize+int64(f.compressedLen) > conf.ShardBytes {
+			flush()
+		}
+		if cur == nil {
+			cur = new(bytes.Buffer)
+			cur.WriteString(generatedComment)
+			fmt.Fprintf(cur, "package %s\n\nfunc init() {\n", conf.Package)
+			curSize = 0
+		}
+		fmt.Fprintf(cur, "\t_escData[%q] = &_escFile{%s\t}\n", f.name, f.block)
+		curSize += int64(f.compressedLen)
+	}
+	flush()
+	return shards, nil
 }
 
 func segment(s *bytes.Buffer) string {
@@ -245,10 +486,13 @@ import (
 	"bytes"
 	"compress/gzip"
 	"encoding/base64"
+	"io"
+	"io/fs"
 	"io/ioutil"
 	"net/http"
 	"os"
 	"path"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -262,11 +506,34 @@ type _escStaticFS struct{}
 
 var _escStatic _escStaticFS
 
+// _escIOLocalFS is the fs.FS counterpart of _escLocalFS: it serves the
+// original, uncompressed files from disk.
+type _escIOLocalFS struct{}
+
+var _escIOLocal _escIOLocalFS
+
+// _escIOStaticFS is the fs.FS counterpart of _escStaticFS: it serves the
+// compressed, embedded copies of the files.
+type _escIOStaticFS struct{}
+
+var _escIOStatic _escIOStaticFS
+
 type _escDirectory struct {
 	fs   http.FileSystem
 	name string
 }
 
+// _escIOSubFS implements fs.FS, plus the optional fs.ReadDirFS, fs.ReadFileFS
+// and fs.StatFS interfaces, rooted at dir within fsys. It backs both
+// {{.FunctionPrefix}}IODir and the Sub method of the top-level filesystems.
+// Glob is intentionally left to fs.Glob's generic, ReadDir-based fallback
+// rather than reimplemented here, since re-prefixing an already-escaped
+// pattern is easy to get wrong.
+type _escIOSubFS struct {
+	fsys fs.FS
+	dir  string
+}
+
 type _escFile struct {
 	compressed string
 	size       int64
@@ -274,9 +541,12 @@ type _escFile struct {
 	local      string
 	isDir      bool
 
+	mode     os.FileMode
+	linkname string
+	uid, gid int
+
 	once sync.Once
 	data []byte
-	name string
 }
 
 func (_escLocalFS) Open(name string) (http.File, error) {
@@ -287,6 +557,74 @@ func (_escLocalFS) Open(name string) (http.File, error) {
 	return os.Open(f.local)
 }
 
+func (_escIOLocalFS) lookup(name string) (*_escFile, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	f, present := _escData[path.Clean("/"+name)]
+	if !present {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return f, nil
+}
+
+func (l _escIOLocalFS) Open(name string) (fs.File, error) {
+	f, err := l.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(f.localPath())
+}
+
+func (l _escIOLocalFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	f, err := l.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadDir(f.localPath())
+}
+
+func (l _escIOLocalFS) ReadFile(name string) ([]byte, error) {
+	f, err := l.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(f.localPath())
+}
+
+func (l _escIOLocalFS) Stat(name string) (fs.FileInfo, error) {
+	f, err := l.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Stat(f.localPath())
+}
+
+func (l _escIOLocalFS) Sub(dir string) (fs.FS, error) {
+	if _, err := l.lookup(dir); err != nil {
+		return nil, err
+	}
+	return _escIOSubFS{fsys: _escIOLocal, dir: path.Clean("/" + dir)}, nil
+}
+
+func (l _escIOLocalFS) Glob(pattern string) ([]string, error) {
+	var matches []string
+	for name, f := range _escData {
+		rel := strings.TrimPrefix(name, "/")
+		ok, err := path.Match(pattern, rel)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			if _, err := os.Stat(f.localPath()); err == nil {
+				matches = append(matches, rel)
+			}
+		}
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
 func (_escStaticFS) prepare(name string) (*_escFile, error) {
 	f, present := _escData[path.Clean(name)]
 	if !present {
@@ -296,10 +634,32 @@ func (_escStaticFS) prepare(name string) (*_escFile, error) {
 	return f, err
 }
 
+func (_escIOStaticFS) prepare(name string) (*_escFile, error) {
+	f, err := _escIOStatic.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	return f, f.prepare()
+}
+
+// lookup finds name's *_escFile without decompressing it: size, mode,
+// modtime and directory entries are all available on the raw, unprepared
+// _escFile, so stat-only callers (Stat, ReadDir, Sub) never pay for a gzip
+// read just to describe or list a file.
+func (_escIOStaticFS) lookup(name string) (*_escFile, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	f, present := _escData[path.Clean("/"+name)]
+	if !present {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return f, nil
+}
+
 func (f *_escFile) prepare() error {
 	var err error
 	f.once.Do(func() {
-		f.name = path.Base(f.local)
 		if f.size == 0 {
 			return
 		}
@@ -325,16 +685,161 @@ func (fs _escStaticFS) Open(name string) (http.File, error) {
 	return f.File()
 }
 
+func (s _escIOStaticFS) Open(name string) (fs.File, error) {
+	f, err := s.prepare(name)
+	if err != nil {
+		return nil, err
+	}
+	return f.IOFile()
+}
+
+func (s _escIOStaticFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	f, err := s.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	return f.readDir()
+}
+
+func (s _escIOStaticFS) ReadFile(name string) ([]byte, error) {
+	f, err := s.prepare(name)
+	if err != nil {
+		return nil, err
+	}
+	// Return a copy: f.data is the cached, shared decompressed buffer, and
+	// fs.ReadFileFS callers are free to mutate what they get back.
+	data := make([]byte, len(f.data))
+	copy(data, f.data)
+	return data, nil
+}
+
+func (s _escIOStaticFS) Stat(name string) (fs.FileInfo, error) {
+	f, err := s.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (s _escIOStaticFS) Sub(dir string) (fs.FS, error) {
+	if _, err := s.lookup(dir); err != nil {
+		return nil, err
+	}
+	return _escIOSubFS{fsys: _escIOStatic, dir: path.Clean("/" + dir)}, nil
+}
+
+func (s _escIOStaticFS) Glob(pattern string) ([]string, error) {
+	var matches []string
+	for name := range _escData {
+		rel := strings.TrimPrefix(name, "/")
+		ok, err := path.Match(pattern, rel)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			matches = append(matches, rel)
+		}
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+func (s _escIOSubFS) full(name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return strings.TrimPrefix(s.dir, "/"), nil
+	}
+	return strings.TrimPrefix(path.Join(s.dir, name), "/"), nil
+}
+
+func (s _escIOSubFS) Open(name string) (fs.File, error) {
+	full, err := s.full(name)
+	if err != nil {
+		return nil, err
+	}
+	return s.fsys.Open(full)
+}
+
+func (s _escIOSubFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	full, err := s.full(name)
+	if err != nil {
+		return nil, err
+	}
+	if rd, ok := s.fsys.(fs.ReadDirFS); ok {
+		return rd.ReadDir(full)
+	}
+	return fs.ReadDir(s.fsys, full)
+}
+
+func (s _escIOSubFS) ReadFile(name string) ([]byte, error) {
+	full, err := s.full(name)
+	if err != nil {
+		return nil, err
+	}
+	if rf, ok := s.fsys.(fs.ReadFileFS); ok {
+		return rf.ReadFile(full)
+	}
+	return fs.ReadFile(s.fsys, full)
+}
+
+func (s _escIOSubFS) Stat(name string) (fs.FileInfo, error) {
+	full, err := s.full(name)
+	if err != nil {
+		return nil, err
+	}
+	if sf, ok := s.fsys.(fs.StatFS); ok {
+		return sf.Stat(full)
+	}
+	return fs.Stat(s.fsys, full)
+}
+
 func (dir _escDirectory) Open(name string) (http.File, error) {
 	return dir.fs.Open(dir.name + name)
 }
 
-func (f *_escFile) File() (http.File, error) {
-	type httpFile struct {
-		*bytes.Reader
-		*_escFile
+// _escFileReader adapts a _escFile's decompressed data into a concrete
+// reader. It satisfies both http.File and fs.File, since the former is a
+// superset of the latter's Stat/Read/Close methods. When the underlying
+// _escFile is a directory it also satisfies fs.ReadDirFile, as required of
+// any directory returned from an fs.FS's Open.
+type _escFileReader struct {
+	*bytes.Reader
+	*_escFile
+
+	dirPos int
+}
+
+func (f *_escFileReader) ReadDir(n int) ([]fs.DirEntry, error) {
+	entries, err := f.readDir()
+	if err != nil {
+		return nil, err
 	}
-	return &httpFile{
+	if f.dirPos >= len(entries) {
+		if n <= 0 {
+			return nil, nil
+		}
+		return nil, io.EOF
+	}
+	end := len(entries)
+	if n > 0 && f.dirPos+n < end {
+		end = f.dirPos + n
+	}
+	res := entries[f.dirPos:end]
+	f.dirPos = end
+	return res, nil
+}
+
+func (f *_escFile) File() (http.File, error) {
+	return &_escFileReader{
+		Reader:   bytes.NewReader(f.data),
+		_escFile: f,
+	}, nil
+}
+
+func (f *_escFile) IOFile() (fs.File, error) {
+	return &_escFileReader{
 		Reader:   bytes.NewReader(f.data),
 		_escFile: f,
 	}, nil
@@ -345,32 +850,51 @@ func (f *_escFile) Close() error {
 }
 
 func (f *_escFile) Readdir(count int) ([]os.FileInfo, error) {
+	entries, err := f.readDir()
+	if err != nil {
+		return nil, err
+	}
+	fis := make([]os.FileInfo, len(entries))
+	for i, e := range entries {
+		fis[i] = e.(os.FileInfo)
+	}
+	return fis, nil
+}
 
-	if !f.isDir  {
+// readDir lists the _escData entries nested under this directory. Unlike the
+// old Readdir, it does not decompress each child just to describe it: name,
+// size, mode and mod time are all available on the unprepared *_escFile, so
+// stat-only callers (fs.WalkDir, fs.Glob, ...) never pay for a gzip read.
+func (f *_escFile) readDir() ([]fs.DirEntry, error) {
+	if !f.isDir {
 		return nil, nil
 	}
 
-	if err := f.prepare(); err != nil {
-		return nil, err
+	dir := "/"
+	for k, v := range _escData {
+		if v == f {
+			dir = k
+			break
+		}
 	}
-
-	prefix := "/"
-	if len(f.local) > 1 {
-		prefix = prefix + f.local + "/"
+	prefix := dir
+	if dir != "/" {
+		prefix = dir + "/"
 	}
 
-	fis := make([]os.FileInfo, 0, len(_escData))
+	entries := make([]fs.DirEntry, 0, len(_escData))
 
 	for k, v := range _escData {
-		if strings.HasPrefix(k, prefix) {
-			if err := v.prepare(); err != nil {
-				return fis, err
-			}
-			fis = append(fis, v)
+		rest := strings.TrimPrefix(k, prefix)
+		if rest == k || rest == "" || strings.Contains(rest, "/") {
+			continue
 		}
+		entries = append(entries, v)
 	}
 
-	return fis, nil
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	return entries, nil
 }
 
 func (f *_escFile) Stat() (os.FileInfo, error) {
@@ -378,7 +902,16 @@ func (f *_escFile) Stat() (os.FileInfo, error) {
 }
 
 func (f *_escFile) Name() string {
-	return f.name
+	return path.Base(f.local)
+}
+
+// localPath is f.local, adjusted for the root directory: it is recorded as
+// "" there (see Run), but os.Open("") fails where os.Open(".") succeeds.
+func (f *_escFile) localPath() string {
+	if f.local == "" {
+		return "."
+	}
+	return f.local
 }
 
 func (f *_escFile) Size() int64 {
@@ -386,7 +919,22 @@ func (f *_escFile) Size() int64 {
 }
 
 func (f *_escFile) Mode() os.FileMode {
-	return 0
+	if f.isDir {
+		return os.ModeDir
+	}
+	return f.mode
+}
+
+// LinkName returns the target of a symlink entry, or "" if f isn't one.
+func (f *_escFile) LinkName() string {
+	return f.linkname
+}
+
+// Owner returns the uid and gid captured for f, and whether the generating
+// Config had PreserveOwnership set; ok is false (and uid, gid are -1) for
+// files embedded without it.
+func (f *_escFile) Owner() (uid, gid int, ok bool) {
+	return f.uid, f.gid, f.uid >= 0 && f.gid >= 0
 }
 
 func (f *_escFile) ModTime() time.Time {
@@ -401,6 +949,16 @@ func (f *_escFile) Sys() interface{} {
 	return f
 }
 
+// Type implements fs.DirEntry.
+func (f *_escFile) Type() fs.FileMode {
+	return f.Mode().Type()
+}
+
+// Info implements fs.DirEntry.
+func (f *_escFile) Info() (fs.FileInfo, error) {
+	return f, nil
+}
+
 // {{.FunctionPrefix}}FS returns a http.Filesystem for the embedded assets. If useLocal is true,
 // the filesystem's contents are instead used.
 func {{.FunctionPrefix}}FS(useLocal bool) http.FileSystem {
@@ -419,6 +977,25 @@ func {{.FunctionPrefix}}Dir(useLocal bool, name string) http.FileSystem {
 	return _escDirectory{fs: _escStatic, name: name}
 }
 
+// {{.FunctionPrefix}}IOFS returns an fs.FS for the embedded assets. If useLocal is true,
+// the filesystem's contents are instead used. The result additionally
+// implements fs.ReadDirFS, fs.ReadFileFS, fs.StatFS, fs.SubFS and fs.GlobFS.
+func {{.FunctionPrefix}}IOFS(useLocal bool) fs.FS {
+	if useLocal {
+		return _escIOLocal
+	}
+	return _escIOStatic
+}
+
+// {{.FunctionPrefix}}IODir returns an fs.FS for the embedded assets on a given prefix dir.
+// If useLocal is true, the filesystem's contents are instead used.
+func {{.FunctionPrefix}}IODir(useLocal bool, name string) fs.FS {
+	if useLocal {
+		return _escIOSubFS{fsys: _escIOLocal, dir: path.Clean("/" + name)}
+	}
+	return _escIOSubFS{fsys: _escIOStatic, dir: path.Clean("/" + name)}
+}
+
 // {{.FunctionPrefix}}FSByte returns the named file from the embedded assets. If useLocal is
 // true, the filesystem's contents are instead used.
 func {{.FunctionPrefix}}FSByte(useLocal bool, name string) ([]byte, error) {
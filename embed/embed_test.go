@@ -0,0 +1,386 @@
+package embed
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// runGenerated writes assets (the output of Run) and a driver main() body
+// into a throwaway module, "go run"s it, and returns its combined output.
+// Several of this package's bugs (the readDir off-by-one, the symlink
+// crash) only showed up once the generated _escFile/_escIOLocalFS/...
+// machinery actually executed, so these tests drive it the same way.
+func runGenerated(t *testing.T, assets []byte, driver string) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module escgentest\n\ngo 1.16\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "assets.go"), assets, 0644); err != nil {
+		t.Fatal(err)
+	}
+	main := "package main\n\nimport (\n\t\"fmt\"\n\t\"io/fs\"\n)\n\nvar _ = fmt.Println\nvar _ = fs.WalkDir\n\nfunc main() {\n" + driver + "\n}\n"
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte(main), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command("go", "run", ".")
+	cmd.Dir = dir
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("go run failed: %v\n%s", err, out.String())
+	}
+	return out.String()
+}
+
+func writeTree(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// TestRun_WalkDirCompletes is a regression test for a readDir off-by-one: a
+// directory whose virtual local path was a single character (a top-level
+// relative dir like "a") made readDir use the wrong prefix and return the
+// root's own children forever, so fs.WalkDir never terminated.
+func TestRun_WalkDirCompletes(t *testing.T) {
+	src := t.TempDir()
+	writeTree(t, filepath.Join(src, "a"), map[string]string{
+		"one.txt":   "one",
+		"b/two.txt": "two",
+	})
+
+	var buf bytes.Buffer
+	conf := &Config{Package: "main", Files: []string{"a"}}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(src); err != nil {
+		t.Fatal(err)
+	}
+	err = Run(conf, &buf)
+	if chdirErr := os.Chdir(wd); chdirErr != nil {
+		t.Fatal(chdirErr)
+	}
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	out := runGenerated(t, buf.Bytes(), `
+	visited := map[string]bool{}
+	err := fs.WalkDir(IOFS(false), ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		visited[p] = true
+		return nil
+	})
+	if err != nil {
+		fmt.Println("WALK_ERROR:", err)
+		return
+	}
+	for _, want := range []string{".", "a", "a/one.txt", "a/b", "a/b/two.txt"} {
+		if !visited[want] {
+			fmt.Println("MISSING:", want)
+		}
+	}
+	fmt.Println("OK", len(visited))
+`)
+	if !contains(out, "OK 5") {
+		t.Fatalf("fs.WalkDir did not visit the expected entries, got:\n%s", out)
+	}
+}
+
+// TestRun_SymlinkToDirectory is a regression test: fs.ReadFile used to be
+// called on every entry before its mode was checked, so a symlink pointing
+// at a directory made Run follow it and fail with "is a directory",
+// aborting the whole embed.
+func TestRun_SymlinkToDirectory(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks require elevated privileges on windows")
+	}
+	src := t.TempDir()
+	writeTree(t, src, map[string]string{"realdir/f.txt": "hi"})
+	if err := os.Symlink("realdir", filepath.Join(src, "linkdir")); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	conf := &Config{Package: "main", Files: []string{src}}
+	if err := Run(conf, &buf); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+}
+
+// TestRun_SymlinkToFile checks that a symlink to a regular file is recorded
+// as a symlink (mode&fs.ModeSymlink set, linkname populated) without also
+// embedding the target's decompressed content under it.
+func TestRun_SymlinkToFile(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks require elevated privileges on windows")
+	}
+	src := t.TempDir()
+	writeTree(t, src, map[string]string{"real.txt": "hello"})
+	if err := os.Symlink("real.txt", filepath.Join(src, "link.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, content, _, _, err := embedContent(&Config{Package: "main", Files: []string{src}})
+	if err != nil {
+		t.Fatalf("embedContent: %v", err)
+	}
+	f, ok := content[filepath.ToSlash(filepath.Join(src, "link.txt"))]
+	if !ok {
+		t.Fatalf("link.txt not found in content: %v", content)
+	}
+	if f.mode&fs.ModeSymlink == 0 {
+		t.Errorf("mode %v does not have ModeSymlink set", f.mode)
+	}
+	if f.linkname != "real.txt" {
+		t.Errorf("linkname = %q, want %q", f.linkname, "real.txt")
+	}
+	if len(f.data) != 0 {
+		t.Errorf("data = %q, want empty: a symlink's own entry shouldn't embed its target's content", f.data)
+	}
+}
+
+// TestRunSharded_Deterministic checks that packing the same content twice
+// produces byte-identical shards, since RunSharded's split is only useful
+// if it's reproducible across builds.
+func TestRunSharded_Deterministic(t *testing.T) {
+	src := t.TempDir()
+	writeTree(t, src, map[string]string{
+		"a.txt": "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa",
+		"b.txt": "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb",
+		"c.txt": "cccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccc",
+	})
+	conf := &Config{Package: "main", Files: []string{src}, ShardBytes: 40}
+
+	s1, err := RunSharded(conf)
+	if err != nil {
+		t.Fatalf("RunSharded (1st): %v", err)
+	}
+	s2, err := RunSharded(conf)
+	if err != nil {
+		t.Fatalf("RunSharded (2nd): %v", err)
+	}
+	if len(s1) < 3 {
+		t.Fatalf("expected at least 3 shards (common + 2 file shards), got %d", len(s1))
+	}
+	if len(s1) != len(s2) {
+		t.Fatalf("shard count differs across runs: %d vs %d", len(s1), len(s2))
+	}
+	for i := range s1 {
+		if s1[i].Suffix != s2[i].Suffix {
+			t.Errorf("shard %d: suffix %q vs %q", i, s1[i].Suffix, s2[i].Suffix)
+		}
+		if !bytes.Equal(s1[i].Code, s2[i].Code) {
+			t.Errorf("shard %d (%s): content differs across identical runs", i, s1[i].Suffix)
+		}
+	}
+}
+
+// TestRun_IOFS_ReadFileStatSubGlob exercises the fs.ReadFileFS, fs.StatFS,
+// fs.SubFS and fs.GlobFS methods the generated code provides on IOFS, via
+// their stdlib fs.ReadFile/fs.Stat/fs.Sub/fs.Glob entry points, the same way
+// an external caller (e.g. html/template.ParseFS) would use them.
+func TestRun_IOFS_ReadFileStatSubGlob(t *testing.T) {
+	src := t.TempDir()
+	writeTree(t, src, map[string]string{
+		"dir/a.txt":     "A",
+		"dir/sub/b.txt": "B",
+	})
+
+	var buf bytes.Buffer
+	conf := &Config{Package: "main", Files: []string{"."}}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(src); err != nil {
+		t.Fatal(err)
+	}
+	err = Run(conf, &buf)
+	if chdirErr := os.Chdir(wd); chdirErr != nil {
+		t.Fatal(chdirErr)
+	}
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	out := runGenerated(t, buf.Bytes(), `
+	fsys := IOFS(false)
+
+	data, err := fs.ReadFile(fsys, "dir/a.txt")
+	if err != nil || string(data) != "A" {
+		fmt.Println("READFILE_FAIL", string(data), err)
+		return
+	}
+
+	fi, err := fs.Stat(fsys, "dir/sub/b.txt")
+	if err != nil || fi.Size() != 1 {
+		fmt.Println("STAT_FAIL", err)
+		return
+	}
+
+	sub, err := fs.Sub(fsys, "dir")
+	if err != nil {
+		fmt.Println("SUB_FAIL", err)
+		return
+	}
+	subData, err := fs.ReadFile(sub, "a.txt")
+	if err != nil || string(subData) != "A" {
+		fmt.Println("SUB_READFILE_FAIL", string(subData), err)
+		return
+	}
+
+	matches, err := fs.Glob(fsys, "dir/*/*.txt")
+	if err != nil || len(matches) != 1 || matches[0] != "dir/sub/b.txt" {
+		fmt.Println("GLOB_FAIL", matches, err)
+		return
+	}
+
+	fmt.Println("ALL_OK")
+`)
+	if !contains(out, "ALL_OK") {
+		t.Fatalf("ReadFile/Stat/Sub/Glob did not all succeed, got:\n%s", out)
+	}
+}
+
+// TestRun_ConfigSource_CustomFS checks that Config.Source lets Run embed
+// from an arbitrary fs.FS -- not just the local disk -- by using an
+// in-memory fstest.MapFS.
+func TestRun_ConfigSource_CustomFS(t *testing.T) {
+	var buf bytes.Buffer
+	conf := &Config{
+		Package: "main",
+		Files:   []string{"."},
+		Source: fstest.MapFS{
+			"greeting.txt":    {Data: []byte("hi")},
+			"nested/name.txt": {Data: []byte("world")},
+		},
+	}
+	if err := Run(conf, &buf); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	out := runGenerated(t, buf.Bytes(), `
+	g, err := fs.ReadFile(IOFS(false), "greeting.txt")
+	if err != nil || string(g) != "hi" {
+		fmt.Println("GREETING_FAIL", string(g), err)
+		return
+	}
+	n, err := fs.ReadFile(IOFS(false), "nested/name.txt")
+	if err != nil || string(n) != "world" {
+		fmt.Println("NAME_FAIL", string(n), err)
+		return
+	}
+	fmt.Println("ALL_OK")
+`)
+	if !contains(out, "ALL_OK") {
+		t.Fatalf("embedding from a custom fs.FS Source failed, got:\n%s", out)
+	}
+}
+
+// TestRun_ArchiveThroughFilesPipeline embeds a real zip file by naming it in
+// Config.Files, exercising the actual isArchivePath/openArchive dispatch
+// inside embedContent's walk -- not just openArchive called directly, the
+// way archive_test.go does it.
+func TestRun_ArchiveThroughFilesPipeline(t *testing.T) {
+	dir := t.TempDir()
+	zipPath := filepath.Join(dir, "bundle.zip")
+	f, err := os.Create(zipPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	w, err := zw.Create("inner/file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("zipped")); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	conf := &Config{Package: "main", Files: []string{zipPath}}
+	if err := Run(conf, &buf); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	out := runGenerated(t, buf.Bytes(), `
+	data, err := fs.ReadFile(IOFS(false), "inner/file.txt")
+	if err != nil || string(data) != "zipped" {
+		fmt.Println("ARCHIVE_FAIL", string(data), err)
+		return
+	}
+	fmt.Println("ALL_OK")
+`)
+	if !contains(out, "ALL_OK") {
+		t.Fatalf("reading a file through an embedded zip archive failed, got:\n%s", out)
+	}
+}
+
+// TestRun_PreserveOwnership checks that Config.PreserveOwnership round-trips
+// the current process's uid/gid into the generated code's _escFile.Owner().
+func TestRun_PreserveOwnership(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uid/gid capture is unix-only")
+	}
+	src := t.TempDir()
+	writeTree(t, src, map[string]string{"f.txt": "data"})
+
+	var buf bytes.Buffer
+	conf := &Config{Package: "main", Files: []string{src}, PreserveOwnership: true}
+	if err := Run(conf, &buf); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	out := runGenerated(t, buf.Bytes(), fmt.Sprintf(`
+	fi, err := fs.Stat(IOFS(false), %q)
+	if err != nil {
+		fmt.Println("STAT_FAIL", err)
+		return
+	}
+	ef, ok := fi.Sys().(interface{ Owner() (int, int, bool) })
+	if !ok {
+		fmt.Println("NO_OWNER_METHOD")
+		return
+	}
+	uid, gid, captured := ef.Owner()
+	fmt.Println("OWNER", uid, gid, captured)
+`, strings.TrimPrefix(filepath.ToSlash(filepath.Join(src, "f.txt")), "/")))
+
+	want := fmt.Sprintf("OWNER %d %d true", os.Getuid(), os.Getgid())
+	if !contains(out, want) {
+		t.Fatalf("Owner() = %q, want to contain %q", out, want)
+	}
+}
+
+func contains(s, substr string) bool {
+	return bytes.Contains([]byte(s), []byte(substr))
+}
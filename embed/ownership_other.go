@@ -0,0 +1,10 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly || solaris || aix)
+
+package embed
+
+import "io/fs"
+
+// statOwnership is a no-op on platforms without a Unix-style Stat_t.
+func statOwnership(fi fs.FileInfo) (uid, gid int) {
+	return -1, -1
+}
@@ -0,0 +1,18 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly || solaris || aix
+
+package embed
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// statOwnership returns fi's uid and gid, or (-1, -1) if its Sys value
+// isn't a *syscall.Stat_t.
+func statOwnership(fi fs.FileInfo) (uid, gid int) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return -1, -1
+	}
+	return int(st.Uid), int(st.Gid)
+}
@@ -0,0 +1,129 @@
+package embed
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDebounce coalesces a burst of filesystem events (for example an
+// editor's save-via-rename, which fires a Remove and a Create) into a
+// single rebuild.
+const watchDebounce = 100 * time.Millisecond
+
+// WaitForChange blocks until a file reachable from conf.Files is created,
+// written, renamed, or removed, debounced by watchDebounce. It watches the
+// real filesystem regardless of conf.Source, since fsnotify has no notion of
+// a virtual fs.FS. Callers drive the re-run loop themselves: call Run, then
+// WaitForChange, then Run again, and so on.
+func WaitForChange(conf *Config) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	dirs, err := watchDirs(conf)
+	if err != nil {
+		return err
+	}
+	for _, dir := range dirs {
+		if err := watcher.Add(dir); err != nil {
+			return err
+		}
+	}
+
+	var debounce <-chan time.Time
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if event.Op == fsnotify.Chmod {
+				continue
+			}
+			if event.Op&fsnotify.Create != 0 {
+				if fi, err := os.Stat(event.Name); err == nil && fi.IsDir() {
+					// Best-effort: if this fails the directory still triggers
+					// a rebuild below, just not for its own future changes.
+					_ = watcher.Add(event.Name)
+				}
+			}
+			debounce = time.After(watchDebounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			return err
+		case <-debounce:
+			return nil
+		}
+	}
+}
+
+// watchDirs returns every directory reached by conf.Files: a file's parent,
+// or a directory and everything beneath it.
+func watchDirs(conf *Config) ([]string, error) {
+	var dirs []string
+	seen := make(map[string]bool)
+	add := func(dir string) {
+		if dir != "" && !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	for _, base := range conf.Files {
+		fi, err := os.Stat(base)
+		if err != nil {
+			return nil, err
+		}
+		if !fi.IsDir() {
+			add(filepath.Dir(base))
+			continue
+		}
+		err = filepath.WalkDir(base, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				add(p)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return dirs, nil
+}
+
+// WriteFileAtomic writes data to a temp file in filepath.Dir(name) and
+// renames it over name, so readers never observe a partially written file.
+// It's intended for callers rewriting Run's output on every WaitForChange
+// cycle, where a reader (e.g. a concurrent `go build`) must never see a
+// partial file.
+func WriteFileAtomic(name string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	if err := os.Rename(tmpName, name); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package embed
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatchDirs(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{
+		"a.txt":     "a",
+		"sub/b.txt": "b",
+	})
+
+	dirs, err := watchDirs(&Config{Files: []string{root}})
+	if err != nil {
+		t.Fatalf("watchDirs: %v", err)
+	}
+	got := map[string]bool{}
+	for _, d := range dirs {
+		got[d] = true
+	}
+	for _, want := range []string{root, filepath.Join(root, "sub")} {
+		if !got[want] {
+			t.Errorf("watchDirs missing %q, got %v", want, dirs)
+		}
+	}
+}
+
+// TestWaitForChange checks the end-to-end -watch primitive: a file written
+// after WaitForChange starts watching is detected, and WaitForChange returns
+// without error within a few seconds.
+func TestWaitForChange(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{"a.txt": "a"})
+
+	done := make(chan error, 1)
+	go func() {
+		done <- WaitForChange(&Config{Files: []string{root}})
+	}()
+
+	// Give the watcher time to register its directories before the change.
+	time.Sleep(50 * time.Millisecond)
+	if err := os.WriteFile(filepath.Join(root, "a.txt"), []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("WaitForChange: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("WaitForChange did not return after a watched file changed")
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "out.go")
+	if err := WriteFileAtomic(name, []byte("first")); err != nil {
+		t.Fatalf("WriteFileAtomic (1st): %v", err)
+	}
+	if err := WriteFileAtomic(name, []byte("second")); err != nil {
+		t.Fatalf("WriteFileAtomic (2nd): %v", err)
+	}
+	got, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "second" {
+		t.Fatalf("ReadFile = %q, want %q", got, "second")
+	}
+	// No leftover .tmp-* sibling from either write.
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("dir has %d entries after WriteFileAtomic, want 1: %v", len(entries), entries)
+	}
+}
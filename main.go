@@ -3,6 +3,10 @@ package main
 import (
 	"flag"
 	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 
 	"github.com/boopathi/esc/embed"
 )
@@ -10,7 +14,8 @@ import (
 func main() {
 	conf := &embed.Config{}
 
-	flag.StringVar(&conf.OutputFile, "o", "", "Output file, else stdout.")
+	var outputFile string
+	flag.StringVar(&outputFile, "o", "", "Output file, else stdout.")
 	flag.StringVar(&conf.Package, "pkg", "main", "Package.")
 	flag.StringVar(&conf.Prefix, "prefix", "", "Prefix to strip from filesnames.")
 	flag.StringVar(&conf.Ignore, "ignore", "", "Regexp for files we should ignore (for example \\\\.DS_Store).")
@@ -18,10 +23,129 @@ func main() {
 	flag.StringVar(&conf.ModTime, "modtime", "", "Unix timestamp to override as modification time for all files.")
 	flag.BoolVar(&conf.Private, "private", false, "If true, do not export autogenerated functions.")
 	flag.BoolVar(&conf.NoCompression, "no-compress", false, "If true, do not compress files.")
+	flag.BoolVar(&conf.Watch, "watch", false, "If true, watch Files and regenerate -o on every change instead of exiting.")
+	flag.Int64Var(&conf.ShardBytes, "shard-bytes", 0, "If greater than zero and -o is set, split output across sibling files named after -o (-o assets.go gives assets_common.go, assets_0.go, assets_1.go, ...) once the embedded data exceeds this many compressed bytes.")
+	flag.BoolVar(&conf.PreserveOwnership, "preserve-ownership", false, "If true, additionally capture each file's uid and gid (Unix only).")
 	flag.Parse()
 	conf.Files = flag.Args()
 
-	if err := embed.Run(conf); err != nil {
+	if err := generate(conf, outputFile); err != nil {
 		log.Fatal(err)
 	}
+	for conf.Watch {
+		if err := embed.WaitForChange(conf); err != nil {
+			log.Fatal(err)
+		}
+		if err := generate(conf, outputFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// generate runs conf once and writes the result to outputFile, or to stdout
+// if outputFile is empty. In watch mode every write is atomic (temp file
+// plus rename), so a concurrent `go build` never observes a partially
+// written file. Sharding (conf.ShardBytes > 0) only applies when outputFile
+// is set: each Shard is written to outputFile with its Suffix inserted
+// before the extension, e.g. "assets.go" becomes "assets_common.go",
+// "assets_0.go", ....
+func generate(conf *embed.Config, outputFile string) error {
+	if outputFile == "" {
+		return embed.Run(conf, os.Stdout)
+	}
+	shards, err := embed.RunSharded(conf)
+	if err != nil {
+		return err
+	}
+	written := make(map[string]bool, len(shards))
+	for _, shard := range shards {
+		name := outputFile
+		if shard.Suffix != "" {
+			ext := filepath.Ext(outputFile)
+			name = strings.TrimSuffix(outputFile, ext) + shard.Suffix + ext
+		}
+		written[name] = true
+		if conf.Watch {
+			if err := embed.WriteFileAtomic(name, shard.Code); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := os.WriteFile(name, shard.Code, 0644); err != nil {
+			return err
+		}
+	}
+	if err := removeStaleShards(outputFile, written); err != nil {
+		return err
+	}
+	return writeShardManifest(outputFile, written)
+}
+
+// shardManifestPath is outputFile's sidecar file recording the shard names
+// generate wrote the last time sharding was active, so a later run can tell
+// exactly which files it owns -- as opposed to globbing names next to
+// outputFile, which can't distinguish an esc-generated shard from an
+// unrelated hand-written file that happens to collide with the naming
+// scheme (e.g. an embed_test.go next to -o embed.go).
+func shardManifestPath(outputFile string) string {
+	return outputFile + ".escshards"
+}
+
+func readShardManifest(outputFile string) (map[string]bool, error) {
+	data, err := os.ReadFile(shardManifestPath(outputFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	names := make(map[string]bool)
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" {
+			names[line] = true
+		}
+	}
+	return names, nil
+}
+
+// writeShardManifest records written as the current shard set, or, once
+// sharding is no longer active (written holds just the single unsharded
+// outputFile), removes the manifest: there's nothing left for a later run
+// to need it for.
+func writeShardManifest(outputFile string, written map[string]bool) error {
+	path := shardManifestPath(outputFile)
+	if len(written) <= 1 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	names := make([]string, 0, len(written))
+	for name := range written {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return os.WriteFile(path, []byte(strings.Join(names, "\n")+"\n"), 0644)
+}
+
+// removeStaleShards deletes shard files recorded in outputFile's manifest
+// (see shardManifestPath) that the current run didn't just (re)write.
+// Without this, a shard count that shrinks across runs -- source files
+// disappearing under -watch, or -shard-bytes simply packing tighter, or
+// sharding being turned off entirely -- leaves old, still-compiling shard
+// files on disk, silently re-embedding their stale content into the build.
+func removeStaleShards(outputFile string, written map[string]bool) error {
+	previous, err := readShardManifest(outputFile)
+	if err != nil {
+		return err
+	}
+	for name := range previous {
+		if written[name] {
+			continue
+		}
+		if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
 }
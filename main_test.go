@@ -0,0 +1,151 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/boopathi/esc/embed"
+)
+
+func writeSrc(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestGenerate_Unsharded(t *testing.T) {
+	srcDir := t.TempDir()
+	writeSrc(t, srcDir, map[string]string{"a.txt": "aaa"})
+
+	outDir := t.TempDir()
+	out := filepath.Join(outDir, "embed.go")
+	conf := &embed.Config{Package: "main", Files: []string{srcDir}}
+	if err := generate(conf, out); err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if _, err := os.Stat(out); err != nil {
+		t.Fatalf("output not written: %v", err)
+	}
+	if _, err := os.Stat(shardManifestPath(out)); !os.IsNotExist(err) {
+		t.Fatalf("manifest should not exist for an unsharded run, stat err = %v", err)
+	}
+}
+
+// TestGenerate_DoesNotDeleteUnrelatedCollidingFile regression-guards the
+// exact scenario from the round-2 review: a hand-written file that happens
+// to collide with the old glob-based shard naming scheme (embed_test.go next
+// to -o embed.go) must survive an ordinary, non-sharded generate call.
+func TestGenerate_DoesNotDeleteUnrelatedCollidingFile(t *testing.T) {
+	srcDir := t.TempDir()
+	writeSrc(t, srcDir, map[string]string{"a.txt": "aaa"})
+
+	outDir := t.TempDir()
+	out := filepath.Join(outDir, "embed.go")
+	collider := filepath.Join(outDir, "embed_test.go")
+	if err := os.WriteFile(collider, []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	conf := &embed.Config{Package: "main", Files: []string{srcDir}}
+	if err := generate(conf, out); err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if _, err := os.Stat(collider); err != nil {
+		t.Fatalf("unrelated file was deleted: %v", err)
+	}
+}
+
+func TestGenerate_ShardManifestLifecycle(t *testing.T) {
+	outDir := t.TempDir()
+	out := filepath.Join(outDir, "embed.go")
+
+	// A run that shards into several files: the manifest should record all
+	// of them, and the common/numbered shard files should all exist.
+	bigSrc := t.TempDir()
+	writeSrc(t, bigSrc, map[string]string{
+		"a.txt": string(make([]byte, 4096)),
+		"b.txt": string(make([]byte, 4096)),
+		"c.txt": string(make([]byte, 4096)),
+	})
+	conf := &embed.Config{Package: "main", Files: []string{bigSrc}, ShardBytes: 64}
+	if err := generate(conf, out); err != nil {
+		t.Fatalf("generate (sharded): %v", err)
+	}
+	first, err := readShardManifest(out)
+	if err != nil {
+		t.Fatalf("readShardManifest: %v", err)
+	}
+	if len(first) < 2 {
+		t.Fatalf("expected multiple shards recorded in manifest, got %v", first)
+	}
+	for name := range first {
+		if _, err := os.Stat(name); err != nil {
+			t.Errorf("shard %q missing on disk: %v", name, err)
+		}
+	}
+
+	// A second run over a single small file packs into fewer shards; the
+	// shard(s) no longer written must be removed, but only those, not
+	// anything outside the manifest.
+	smallSrc := t.TempDir()
+	writeSrc(t, smallSrc, map[string]string{"a.txt": "aaa"})
+	conf = &embed.Config{Package: "main", Files: []string{smallSrc}, ShardBytes: 64}
+	if err := generate(conf, out); err != nil {
+		t.Fatalf("generate (shrunk): %v", err)
+	}
+	second, err := readShardManifest(out)
+	if err != nil {
+		t.Fatalf("readShardManifest: %v", err)
+	}
+	for name := range first {
+		if second[name] {
+			continue
+		}
+		if _, err := os.Stat(name); !os.IsNotExist(err) {
+			t.Errorf("stale shard %q was not removed, stat err = %v", name, err)
+		}
+	}
+
+	// Disabling sharding entirely removes the manifest along with any
+	// remaining shard files it still referenced.
+	conf = &embed.Config{Package: "main", Files: []string{smallSrc}}
+	if err := generate(conf, out); err != nil {
+		t.Fatalf("generate (unsharded): %v", err)
+	}
+	if _, err := os.Stat(shardManifestPath(out)); !os.IsNotExist(err) {
+		t.Errorf("manifest should be removed once sharding is disabled, stat err = %v", err)
+	}
+	for name := range second {
+		if name == out {
+			continue
+		}
+		if _, err := os.Stat(name); !os.IsNotExist(err) {
+			t.Errorf("shard %q left behind after disabling sharding, stat err = %v", name, err)
+		}
+	}
+}
+
+func TestRemoveStaleShards_LeavesUnmanagedFilesAlone(t *testing.T) {
+	outDir := t.TempDir()
+	out := filepath.Join(outDir, "embed.go")
+	unrelated := filepath.Join(outDir, "embed_helpers.go")
+	if err := os.WriteFile(unrelated, []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// No manifest exists yet, so removeStaleShards must be a no-op.
+	if err := removeStaleShards(out, map[string]bool{out: true}); err != nil {
+		t.Fatalf("removeStaleShards: %v", err)
+	}
+	if _, err := os.Stat(unrelated); err != nil {
+		t.Fatalf("unmanaged file was touched: %v", err)
+	}
+}